@@ -3,24 +3,31 @@
 package pixeldrain
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/fshttp"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/lib/rest"
 )
 
 const (
 	filesystemEndpoint = "/filesystem"
 	userEndpoint       = "/user"
-	logRequests        = true
 )
 
 // Register with Fs
@@ -47,15 +54,39 @@ func init() {
 			Default:  "https://pixeldrain.com/api",
 			Advanced: true,
 			Required: true,
+		}, {
+			Name: "upload_cutoff",
+			Help: "Cutoff for switching to chunked upload.\n\n" +
+				"Files above this size will be uploaded in parts of chunk_size.",
+			Default:  fs.SizeSuffix(96 * 1024 * 1024),
+			Advanced: true,
+		}, {
+			Name: "chunk_size",
+			Help: "Chunk size to use for uploading.\n\n" +
+				"Each chunk is uploaded with its own PUT request. An interrupted upload\n" +
+				"is started again from the beginning; only a remote file that already\n" +
+				"matches the source's size and SHA-256 is not uploaded again.",
+			Default:  fs.SizeSuffix(96 * 1024 * 1024),
+			Advanced: true,
+		}, {
+			Name: "upload_concurrency",
+			Help: "Number of chunks of the same file to upload concurrently.\n\n" +
+				"Increasing this will increase throughput on high latency links at the\n" +
+				"cost of using more memory, since chunk_size is buffered per upload slot.",
+			Default:  4,
+			Advanced: true,
 		}},
 	})
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	APIKey   string `config:"api_key"`
-	BucketID string `config:"bucket_id"`
-	APIURL   string `config:"api_url"`
+	APIKey            string        `config:"api_key"`
+	BucketID          string        `config:"bucket_id"`
+	APIURL            string        `config:"api_url"`
+	UploadCutoff      fs.SizeSuffix `config:"upload_cutoff"`
+	ChunkSize         fs.SizeSuffix `config:"chunk_size"`
+	UploadConcurrency int           `config:"upload_concurrency"`
 }
 
 // ItemMeta defines metadata we cache for each Item ID
@@ -78,6 +109,18 @@ type Fs struct {
 	// from every API response containing a path. The pathPrefix must start with
 	// a slash because the API also starts each path with a slash
 	pathPrefix string
+
+	sharesMu sync.Mutex             // protects shares
+	shares   map[string]cachedShare // node path -> share, so repeat PublicLink calls are idempotent
+}
+
+// cachedShare is a cache entry in Fs.shares: the link created for a node
+// path, tagged with the expiry it was created with so a later PublicLink
+// call asking for a different expiry creates a fresh share instead of
+// returning a stale one
+type cachedShare struct {
+	link   string
+	expire fs.Duration
 }
 
 // Object describes a pixeldrain file
@@ -145,13 +188,9 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		name, root, opt.BucketID, opt.APIURL+filesystemEndpoint+f.pathPrefix,
 	)
 
-	return f, nil
-}
+	fs.Debugf(f, "NewFs using endpoint '%s'", opt.APIURL+filesystemEndpoint+f.pathPrefix)
 
-func logRequest(str string, args ...any) {
-	if logRequests {
-		fmt.Printf(str+"\n", args...)
-	}
+	return f, nil
 }
 
 // =================================
@@ -169,7 +208,7 @@ var _ fs.Fs = (*Fs)(nil)
 // This should return ErrDirNotFound if the directory isn't
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
-	logRequest("List '%s'", dir)
+	fs.Debugf(f, "List '%s'", dir)
 
 	fsp, err := f.stat(ctx, dir)
 	if err == errNotFound {
@@ -193,11 +232,11 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 // NewObject finds the Object at remote.  If it can't be found
 // it returns the error fs.ErrorObjectNotFound.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
-	logRequest("NewObject '%s'", remote)
+	fs.Debugf(f, "NewObject '%s'", remote)
 
 	fsp, err := f.stat(ctx, remote)
 	if err == errNotFound {
-		logRequest("Object '%s' does not exist", remote)
+		fs.Debugf(f, "Object '%s' does not exist", remote)
 		return nil, fs.ErrorObjectNotFound
 	} else if err != nil {
 		return nil, err
@@ -213,7 +252,11 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 //
 // The new object may have been created if an error is returned
 func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
-	logRequest("Put '%s'", src.Remote())
+	fs.Debugf(f, "Put '%s'", src.Remote())
+
+	if src.Size() < 0 || src.Size() > int64(f.opt.UploadCutoff) {
+		return f.putChunked(ctx, in, src, options...)
+	}
 
 	_, err := f.put(ctx, src.Remote(), in, options)
 	if err != nil {
@@ -232,9 +275,65 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 	return f.nodeToObject(fsp), nil
 }
 
+// putChunked uploads src in parts of chunk_size through an objectWriter, the
+// same writer OpenWriterAt hands to rclone's multi-thread transfer engine,
+// uploading up to upload_concurrency chunks at once
+func (f *Fs) putChunked(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	// resumeOffset can only be trusted here because it verifies the existing
+	// remote content against src's own hash; OpenWriterAt's generic callers
+	// (e.g. the multi-thread transfer engine) don't have a src to verify
+	// against, so they always start from scratch
+	offset, err := f.resumeOffset(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chunked upload: %w", err)
+	}
+	w := &objectWriter{ctx: ctx, f: f, remote: src.Remote(), size: src.Size(), offset: offset}
+
+	var (
+		g      errgroup.Group
+		tokens = make(chan struct{}, f.opt.UploadConcurrency)
+		pos    int64
+	)
+	for {
+		buf := make([]byte, f.opt.ChunkSize)
+		n, readErr := io.ReadFull(in, buf)
+		if n > 0 {
+			chunk, chunkOffset := buf[:n], pos
+			tokens <- struct{}{}
+			g.Go(func() error {
+				defer func() { <-tokens }()
+				_, writeErr := w.WriteAt(chunk, chunkOffset)
+				return writeErr
+			})
+			pos += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		} else if readErr != nil {
+			return nil, fmt.Errorf("failed to read source: %w", readErr)
+		}
+	}
+	if err = g.Wait(); err != nil {
+		return nil, fmt.Errorf("failed to upload chunk: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	fsp, err := f.update(
+		ctx, src.Remote(),
+		map[string]any{"modified": src.ModTime(ctx)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.nodeToObject(fsp), nil
+}
+
 // Mkdir creates the container if it doesn't exist
 func (f *Fs) Mkdir(ctx context.Context, dir string) (err error) {
-	logRequest("Mkdir '%s'", dir)
+	fs.Debugf(f, "Mkdir '%s'", dir)
 
 	err = f.mkdir(ctx, dir)
 	if err == errNotFound {
@@ -250,7 +349,7 @@ func (f *Fs) Mkdir(ctx context.Context, dir string) (err error) {
 //
 // Returns an error if it isn't empty
 func (f *Fs) Rmdir(ctx context.Context, dir string) (err error) {
-	logRequest("Rmdir '%s'", dir)
+	fs.Debugf(f, "Rmdir '%s'", dir)
 
 	err = f.delete(ctx, dir, false)
 	if err == errNotFound {
@@ -294,7 +393,7 @@ var _ fs.Purger = (*Fs)(nil)
 //
 // Return an error if it doesn't exist
 func (f *Fs) Purge(ctx context.Context, dir string) (err error) {
-	logRequest("Purge '%s'", dir)
+	fs.Debugf(f, "Purge '%s'", dir)
 
 	err = f.delete(ctx, dir, true)
 	if err == errNotFound {
@@ -303,6 +402,53 @@ func (f *Fs) Purge(ctx context.Context, dir string) (err error) {
 	return err
 }
 
+// =====================================
+// Implementation of fs.Copier interface
+// =====================================
+var _ fs.Copier = (*Fs)(nil)
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	fs.Debugf(f, "Copy '%s' '%s'", src.Remote(), remote)
+
+	_, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+
+	err := f.copy(ctx, src.Remote(), remote)
+	if err == errNotFound {
+		return nil, fs.ErrorCantCopy
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	return f.NewObject(ctx, remote)
+}
+
+// copy calls the filesystem "copy" action on remote, asking the server to
+// duplicate it at target without the data passing through this client,
+// mirroring how rename asks the server to move a path in place
+func (f *Fs) copy(ctx context.Context, remote, target string) error {
+	opts := rest.Opts{
+		Method:     "POST",
+		Path:       rest.URLPathEscape(remote),
+		Parameters: url.Values{"action": {"copy"}, "target": {target}},
+		NoResponse: true,
+	}
+	_, err := f.srv.Call(ctx, &opts)
+	return err
+}
+
 // ====================================
 // Implementation of fs.Mover interface
 // ====================================
@@ -318,7 +464,7 @@ var _ fs.Mover = (*Fs)(nil)
 //
 // If it isn't possible then return fs.ErrorCantMove
 func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
-	logRequest("Move '%s' '%s'", src.Remote(), remote)
+	fs.Debugf(f, "Move '%s' '%s'", src.Remote(), remote)
 
 	srcObj, ok := src.(*Object)
 	if !ok {
@@ -326,13 +472,15 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		return nil, fs.ErrorCantMove
 	}
 
-	err := f.rename(ctx, src.Remote(), remote)
+	oldRemote := src.Remote()
+	err := f.rename(ctx, oldRemote, remote)
 	if err == errNotFound {
 		return nil, fs.ErrorCantMove
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to rename file: %w", err)
 	}
 
+	f.rekeyShares(oldRemote, remote)
 	srcObj.base.Path = remote
 	return srcObj, nil
 }
@@ -352,18 +500,157 @@ var _ fs.DirMover = (*Fs)(nil)
 //
 // If it isn't possible then return fs.ErrorCantMove
 func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) (err error) {
-	logRequest("DirMove '%s' '%s'", srcRemote, dstRemote)
+	fs.Debugf(f, "DirMove '%s' '%s'", srcRemote, dstRemote)
 
 	err = f.rename(ctx, srcRemote, dstRemote)
 	if err == errNotFound {
 		return fs.ErrorDirNotFound
 	} else if err == errExists {
 		return fs.ErrorDirExists
+	} else if err != nil {
+		return err
+	}
+
+	f.rekeyShares(srcRemote, dstRemote)
+	return nil
+}
+
+// rekeyShares moves any cached share whose key is old, or nested under
+// old/, so it stays associated with its node after a rename or directory
+// move instead of silently going stale under the pre-move path
+func (f *Fs) rekeyShares(oldPath, newPath string) {
+	f.sharesMu.Lock()
+	defer f.sharesMu.Unlock()
+
+	for path, share := range f.shares {
+		if path == oldPath {
+			delete(f.shares, path)
+			f.shares[newPath] = share
+		} else if suffix, ok := strings.CutPrefix(path, oldPath+"/"); ok {
+			delete(f.shares, path)
+			f.shares[newPath+"/"+suffix] = share
+		}
+	}
+}
+
+// ==============================================
+// Implementation of fs.OpenWriterAtter interface
+// ==============================================
+var _ fs.OpenWriterAtter = (*Fs)(nil)
+
+// OpenWriterAt opens the remote at the given size for random access writes.
+//
+// This is used by the multi-thread transfer code in rclone/fs/operations to
+// upload a single file over several connections at once. putChunked does not
+// call it, but builds the same objectWriter itself with a resume offset.
+func (f *Fs) OpenWriterAt(ctx context.Context, remote string, size int64) (fs.WriterAtCloser, error) {
+	fs.Debugf(f, "OpenWriterAt '%s' size=%d", remote, size)
+
+	// There's no src here to verify a pre-existing remote against (see
+	// resumeOffset), so this always starts from scratch rather than guessing
+	// that an existing file of the right size is a resumable upload
+	return &objectWriter{ctx: ctx, f: f, remote: remote, size: size}, nil
+}
+
+// resumeOffset returns how many bytes at the start of remote can safely be
+// skipped when (re-)uploading src: that's only safe once we've confirmed the
+// bytes already on the server are byte-for-byte identical to src, via a
+// matching size and SHA-256 hash. A same-size file at remote is not enough
+// on its own - it may simply be the file being overwritten - so any mismatch,
+// or inability to compare hashes at all, means start from 0 and re-upload
+// everything.
+func (f *Fs) resumeOffset(ctx context.Context, src fs.ObjectInfo) (int64, error) {
+	fsp, err := f.stat(ctx, src.Remote())
+	if err == errNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to check for existing upload: %w", err)
+	}
+
+	node := fsp.Path[fsp.BaseIndex]
+	if node.FileSize != src.Size() || node.SHA256Sum == "" {
+		return 0, nil
+	}
+
+	srcHash, err := src.Hash(ctx, hash.SHA256)
+	if err != nil || srcHash == "" || !strings.EqualFold(srcHash, node.SHA256Sum) {
+		return 0, nil
 	}
 
+	// remote already holds exactly this content, so nothing needs resending
+	return node.FileSize, nil
+}
+
+// putChunk uploads data as the byte range [offset, offset+len(data)) of
+// remote with a single ranged PUT, identified by a Content-Range header.
+// The total size isn't known here since chunks can land out of order and
+// concurrently; objectWriter.Close verifies the finished size separately
+// once every chunk has been written.
+func (f *Fs) putChunk(ctx context.Context, remote string, offset int64, data []byte) error {
+	size := int64(len(data))
+	opts := rest.Opts{
+		Method:        "PUT",
+		Path:          rest.URLPathEscape(remote),
+		Body:          bytes.NewReader(data),
+		ContentLength: &size,
+		ContentRange:  fmt.Sprintf("bytes %d-%d/*", offset, offset+size-1),
+		NoResponse:    true,
+	}
+	_, err := f.srv.Call(ctx, &opts)
 	return err
 }
 
+// objectWriter implements fs.WriterAtCloser on top of pixeldrain's
+// filesystem bucket append/patch semantics. Each WriteAt issues a ranged PUT
+// for the chunk it is given, so writes may be issued out of order and from
+// multiple goroutines at once.
+type objectWriter struct {
+	ctx    context.Context
+	f      *Fs
+	remote string
+	size   int64
+	offset int64 // bytes the server already had when the writer was opened
+}
+
+// WriteAt uploads p as the byte range [off, off+len(p)) of remote, skipping
+// (or trimming) any part of the range below w.offset, which the server
+// already has
+func (w *objectWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	if off+int64(len(p)) <= w.offset {
+		return len(p), nil
+	}
+	if off < w.offset {
+		skip := w.offset - off
+		p = p[skip:]
+		off = w.offset
+	}
+
+	if err = w.f.putChunk(w.ctx, w.remote, off, p); err != nil {
+		return 0, fmt.Errorf("failed to write chunk at offset %d: %w", off, err)
+	}
+	return len(p), nil
+}
+
+// Close finalizes the upload, verifying the size the finished file ended up
+// with and logging the SHA-256 the server reports for it; the hash is not
+// compared against anything
+func (w *objectWriter) Close() error {
+	fsp, err := w.f.stat(w.ctx, w.remote)
+	if err != nil {
+		return fmt.Errorf("failed to finalize chunked upload: %w", err)
+	}
+
+	node := fsp.Path[fsp.BaseIndex]
+	// w.size is -1 when src's size wasn't known up front (e.g. streamed
+	// input), in which case there's nothing to compare the upload against
+	if w.size >= 0 && node.FileSize != w.size {
+		return fmt.Errorf("chunked upload of '%s' is incomplete: got %d bytes, expected %d", w.remote, node.FileSize, w.size)
+	}
+
+	fs.Debugf(w.f, "finished chunked upload of '%s', server reports sha256 %s", w.remote, node.SHA256Sum)
+	return nil
+}
+
 // ======================================
 // Implementation of fs.Abouter interface
 // ======================================
@@ -371,22 +658,240 @@ var _ fs.Abouter = (*Fs)(nil)
 
 // About gets quota information
 func (f *Fs) About(ctx context.Context) (usage *fs.Usage, err error) {
-	logRequest("About")
+	fs.Debugf(f, "About")
 
 	user, err := f.userInfo(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read user info: %w", err)
 	}
 
-	if user.Subscription.StorageSpace == -1 {
-		user.Subscription.StorageSpace = 1e15 // 1 PB
+	usage = &fs.Usage{Used: fs.NewUsageValue(user.StorageSpaceUsed)}
+
+	// -1 means the account has no storage quota, so Total/Free are left unset
+	if user.Subscription.StorageSpace != -1 {
+		free := user.Subscription.StorageSpace - user.StorageSpaceUsed
+		if free < 0 {
+			free = 0
+		}
+		usage.Total = fs.NewUsageValue(user.Subscription.StorageSpace)
+		usage.Free = fs.NewUsageValue(free)
+	}
+
+	return usage, nil
+}
+
+// ============================================
+// Implementation of fs.PublicLinker interface
+// ============================================
+var _ fs.PublicLinker = (*Fs)(nil)
+
+// PublicLink generates a public link to the remote path (usually readable by
+// anyone)
+func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration, unlink bool) (link string, err error) {
+	fs.Debugf(f, "PublicLink '%s' unlink=%t", remote, unlink)
+
+	if !f.loggedIn {
+		return "", errors.New("sharing requires a pixeldrain account, please set the api_key option")
+	}
+
+	fsp, err := f.stat(ctx, remote)
+	if err == errNotFound {
+		return "", fs.ErrorObjectNotFound
+	} else if err != nil {
+		return "", err
+	}
+	node := fsp.Path[fsp.BaseIndex]
+
+	if unlink {
+		if err = f.unshare(ctx, node.Path); err != nil {
+			return "", fmt.Errorf("failed to revoke share: %w", err)
+		}
+		f.sharesMu.Lock()
+		delete(f.shares, node.Path)
+		f.sharesMu.Unlock()
+		return "", nil
+	}
+
+	f.sharesMu.Lock()
+	cached, ok := f.shares[node.Path]
+	f.sharesMu.Unlock()
+	if ok && cached.expire == expire {
+		return cached.link, nil
+	}
+
+	if node.Type == "dir" {
+		link, err = f.shareDir(ctx, node.Path, expire)
+	} else {
+		link, err = f.shareFile(ctx, node.Path, expire)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create share: %w", err)
+	}
+
+	f.sharesMu.Lock()
+	if f.shares == nil {
+		f.shares = make(map[string]cachedShare)
+	}
+	f.shares[node.Path] = cachedShare{link: link, expire: expire}
+	f.sharesMu.Unlock()
+
+	return link, nil
+}
+
+// shareFile publishes a single file through the filesystem "share" action and
+// returns the resulting pixeldrain.com/u/<id> URL
+func (f *Fs) shareFile(ctx context.Context, remote string, expire fs.Duration) (string, error) {
+	id, err := f.share(ctx, remote, expire)
+	if err != nil {
+		return "", err
+	}
+	return f.baseURL() + "/u/" + id, nil
+}
+
+// shareDir publishes a directory as a shared bucket/list and returns the
+// resulting pixeldrain.com/l/<id> URL
+func (f *Fs) shareDir(ctx context.Context, remote string, expire fs.Duration) (string, error) {
+	id, err := f.share(ctx, remote, expire)
+	if err != nil {
+		return "", err
+	}
+	return f.baseURL() + "/l/" + id, nil
+}
+
+// share calls the filesystem "share" action on remote and returns the share
+// ID the server assigned to it
+func (f *Fs) share(ctx context.Context, remote string, expire fs.Duration) (string, error) {
+	opts := rest.Opts{
+		Method:     "POST",
+		Path:       rest.URLPathEscape(remote),
+		Parameters: url.Values{"action": {"share"}},
+	}
+	if expire != 0 {
+		opts.Parameters.Set("expiry", fmt.Sprint(int64(time.Duration(expire).Seconds())))
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	_, err := f.srv.CallJSON(ctx, &opts, nil, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// unshare calls the filesystem "unshare" action on remote, revoking any
+// public share that was created for it
+func (f *Fs) unshare(ctx context.Context, remote string) error {
+	opts := rest.Opts{
+		Method:     "POST",
+		Path:       rest.URLPathEscape(remote),
+		Parameters: url.Values{"action": {"unshare"}},
+		NoResponse: true,
+	}
+	_, err := f.srv.Call(ctx, &opts)
+	return err
+}
+
+// baseURL returns the pixeldrain web root, derived from the configured API
+// URL, so that share links point at the website rather than the API
+func (f *Fs) baseURL() string {
+	return strings.TrimSuffix(f.opt.APIURL, "/api")
+}
+
+// =======================================
+// Implementation of fs.ListRer interface
+// =======================================
+var _ fs.ListRer = (*Fs)(nil)
+
+// errRecursionNotSupported is returned by statRecursive when the server
+// rejects the recursive stat parameter, so ListR knows to fall back to a
+// plain directory-by-directory walk instead
+var errRecursionNotSupported = errors.New("pixeldrain: recursive stat not supported by this server")
+
+// statRecursive calls the filesystem stat endpoint with stat_recursive=true
+// so the whole subtree under dir comes back flattened into Children in a
+// single request, instead of one request per directory level
+func (f *Fs) statRecursive(ctx context.Context, dir string) (*FilesystemPath, error) {
+	opts := rest.Opts{
+		Method:     "GET",
+		Path:       rest.URLPathEscape(dir),
+		Parameters: url.Values{"stat_recursive": {"true"}},
+	}
+
+	var result FilesystemPath
+	resp, err := f.srv.CallJSON(ctx, &opts, nil, &result)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusBadRequest {
+			return nil, errRecursionNotSupported
+		}
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListR lists the objects and directories of dir recursively, passing them
+// to callback.
+//
+// dir should be "" to start from the root, and should not have trailing
+// slashes.
+//
+// This should return ErrDirNotFound if the directory isn't found.
+//
+// It should call callback for each tranche of entries read. These need not
+// be returned in any particular order. If callback returns an error then
+// the listing will stop immediately.
+//
+// Don't implement this unless you have a more efficient way of listing
+// recursively than doing a directory traversal.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	fs.Debugf(f, "ListR '%s'", dir)
+
+	fsp, err := f.statRecursive(ctx, dir)
+	if err == errNotFound {
+		return fs.ErrorDirNotFound
+	} else if err == errRecursionNotSupported {
+		// Older pixeldrain deployments don't understand the recursive stat
+		// flag, fall back to a plain directory-by-directory walk
+		fs.Debugf(f, "server rejected recursive stat, falling back to List")
+		dirs := []string{dir}
+		for len(dirs) > 0 {
+			entries, err := f.List(ctx, dirs[0])
+			if err != nil {
+				return err
+			}
+			dirs = dirs[1:]
+			for _, entry := range entries {
+				if sub, ok := entry.(fs.Directory); ok {
+					dirs = append(dirs, sub.Remote())
+				}
+			}
+			if err = callback(entries); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// The recursive stat returns the whole subtree flattened into Children,
+	// so no further walking is needed. list.NewHelper passes them to callback
+	// in fixed-size batches and flushes the rest at the end; a batch can mix
+	// entries from several directories.
+	helper := list.NewHelper(callback)
+	for i := range fsp.Children {
+		if fsp.Children[i].Type == "dir" {
+			err = helper.Add(f.nodeToDirectory(fsp.Children[i]))
+		} else {
+			err = helper.Add(f.nodeToObject(fsp.Children[i]))
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	return &fs.Usage{
-		Used:  fs.NewUsageValue(user.StorageSpaceUsed),
-		Total: fs.NewUsageValue(user.Subscription.StorageSpace),
-		Free:  fs.NewUsageValue(user.StorageSpaceUsed - user.Subscription.StorageSpace),
-	}, nil
+	return helper.Flush()
 }
 
 // =====================================
@@ -396,7 +901,7 @@ var _ fs.Object = (*Object)(nil)
 
 // SetModTime sets the modification time of the local fs object
 func (o *Object) SetModTime(ctx context.Context, modTime time.Time) (err error) {
-	logRequest("SetModTime '%s'", o.base.Path)
+	fs.Debugf(o, "SetModTime '%s'", o.base.Path)
 
 	_, err = o.fs.update(ctx, o.base.Path, map[string]any{"modified": modTime})
 	if err == nil {
@@ -407,7 +912,7 @@ func (o *Object) SetModTime(ctx context.Context, modTime time.Time) (err error)
 
 // Open an object for read
 func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (in io.ReadCloser, err error) {
-	logRequest("Open '%s'", o.base.Path)
+	fs.Debugf(o, "Open '%s'", o.base.Path)
 
 	return o.fs.read(ctx, o.base.Path, options)
 }
@@ -418,7 +923,7 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (in io.Read
 //
 // The new object may have been created if an error is returned.
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (err error) {
-	logRequest("Update '%s' '%d'", src.Remote(), src.Size())
+	fs.Debugf(o, "Update '%s' '%d'", src.Remote(), src.Size())
 
 	newObj, err := o.fs.Put(ctx, in, src, options...)
 	if err == nil {
@@ -431,7 +936,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 
 // Remove an object
 func (o *Object) Remove(ctx context.Context) error {
-	logRequest("Remove '%s'", o.base.Path)
+	fs.Debugf(o, "Remove '%s'", o.base.Path)
 
 	return o.fs.delete(ctx, o.base.Path, false)
 }